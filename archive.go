@@ -0,0 +1,187 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ArchiveEntry describes a single file to place inside an archive.
+type ArchiveEntry struct {
+	Name string      // path of the file inside the archive
+	Path string      // source file on disk
+	Mode os.FileMode // mode recorded in the archive header
+}
+
+// Archiver packs a set of ArchiveEntry values into dst in a particular format.
+type Archiver interface {
+	// Extension returns the file extension (without a leading dot) this
+	// Archiver produces, eg. "zip" or "tar.gz".
+	Extension() string
+
+	// Write packs entries into dst.
+	Write(dst io.Writer, entries []ArchiveEntry) error
+}
+
+// NewArchiver returns the Archiver registered for kind, eg. "zip", "tar.gz" or "tar.zst".
+//
+//	ex: archiver, err := NewArchiver("tar.gz")
+func NewArchiver(kind string) (Archiver, error) {
+	switch kind {
+	case "zip":
+		return ZipArchiver{}, nil
+	case "tar.gz":
+		return TarGzArchiver{}, nil
+	case "tar.zst":
+		return TarZstArchiver{}, nil
+	default:
+		return nil, fmt.Errorf("unknown archive format %q", kind)
+	}
+}
+
+// writeEntry copies the source file named by entry.Path into w, used by the
+// tar-based archivers which otherwise only differ in their outer writer.
+func writeEntry(w io.Writer, entry ArchiveEntry) error {
+	file, err := os.Open(entry.Path)
+	if err != nil {
+		return fmt.Errorf("error opening entry %s: %w", entry.Path, err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(w, file); err != nil {
+		return fmt.Errorf("error copying entry %s: %w", entry.Path, err)
+	}
+
+	return nil
+}
+
+// ZipArchiver packs entries into a zip archive, the typical Windows convention.
+type ZipArchiver struct{}
+
+func (ZipArchiver) Extension() string { return "zip" }
+
+func (ZipArchiver) Write(dst io.Writer, entries []ArchiveEntry) error {
+	zipWriter := zip.NewWriter(dst)
+	defer zipWriter.Close()
+
+	for _, entry := range entries {
+		header := &zip.FileHeader{
+			Name:   entry.Name,
+			Method: zip.Deflate,
+		}
+		header.SetMode(entry.Mode)
+
+		zipEntry, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return fmt.Errorf("error creating zip entry %s: %w", entry.Name, err)
+		}
+
+		if err := writeEntry(zipEntry, entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TarGzArchiver packs entries into a gzip-compressed tar archive, the
+// conventional format for Unix-like release artifacts.
+type TarGzArchiver struct{}
+
+func (TarGzArchiver) Extension() string { return "tar.gz" }
+
+func (TarGzArchiver) Write(dst io.Writer, entries []ArchiveEntry) error {
+	gzipWriter := gzip.NewWriter(dst)
+	defer gzipWriter.Close()
+
+	return writeTar(gzipWriter, entries)
+}
+
+// TarZstArchiver packs entries into a zstd-compressed tar archive.
+type TarZstArchiver struct{}
+
+func (TarZstArchiver) Extension() string { return "tar.zst" }
+
+func (TarZstArchiver) Write(dst io.Writer, entries []ArchiveEntry) error {
+	zstdWriter, err := zstd.NewWriter(dst)
+	if err != nil {
+		return fmt.Errorf("error creating zstd writer: %w", err)
+	}
+	defer zstdWriter.Close()
+
+	return writeTar(zstdWriter, entries)
+}
+
+// archiveKinds returns the archive formats to produce for artifact, preferring
+// its own Archives override over config.Archives.
+func archiveKinds(config *Config, artifact Artifact) []string {
+	if len(artifact.Archives) > 0 {
+		return artifact.Archives
+	}
+	return config.Archives
+}
+
+// archiveEntries builds the entry list for artifact's archive: the built
+// binary at the root, followed by config.ExtraFiles resolved against
+// config.SrcDir.
+func archiveEntries(config *Config, artifact Artifact, artifactFile string) ([]ArchiveEntry, error) {
+	entries := []ArchiveEntry{
+		{
+			Name: filepath.Base(artifactFile),
+			Path: artifactFile,
+			Mode: 0755, // make the artifact executable for unix-likes
+		},
+	}
+
+	for _, extra := range config.ExtraFiles {
+		path := filepath.Join(config.SrcDir, extra)
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("error statting extra file %s: %w", path, err)
+		}
+
+		entries = append(entries, ArchiveEntry{
+			Name: filepath.Base(path),
+			Path: path,
+			Mode: info.Mode(),
+		})
+	}
+
+	return entries, nil
+}
+
+// writeTar streams entries into a tar archive written to w.
+func writeTar(w io.Writer, entries []ArchiveEntry) error {
+	tarWriter := tar.NewWriter(w)
+	defer tarWriter.Close()
+
+	for _, entry := range entries {
+		info, err := os.Stat(entry.Path)
+		if err != nil {
+			return fmt.Errorf("error statting entry %s: %w", entry.Path, err)
+		}
+
+		header := &tar.Header{
+			Name: entry.Name,
+			Size: info.Size(),
+			Mode: int64(entry.Mode), // keep the artifact executable inside the tarball
+		}
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return fmt.Errorf("error writing tar header %s: %w", entry.Name, err)
+		}
+
+		if err := writeEntry(tarWriter, entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"archive/zip"
+	"context"
 	"fmt"
 	"hash"
 	"io"
@@ -9,7 +9,6 @@ import (
 	"os"
 	"os/exec"
 	"path"
-	"path/filepath"
 )
 
 // Artifact defines a build target for Go binaries.
@@ -19,36 +18,57 @@ type Artifact struct {
 	ARCH       string `json:"arch"`
 	CGOEnabled bool   `json:"cgoEnabled,omitzero"`
 
+	// Flags are expanded as Go templates (see TemplateContext) before being
+	// passed to `go build`, eg. "-ldflags=-X main.version={{.Version}}".
 	Flags []string `json:"flags,omitzero"`
+
+	// Env holds extra build-time environment variables for this artifact,
+	// applied on top of Config.Env.
+	Env map[string]string `json:"env,omitzero"`
+
+	// Archives overrides Config.Archives for this artifact when non-empty.
+	Archives []string `json:"archives,omitzero"`
+
+	// Compress runs the Config.UPX pass against the built binary before it's
+	// checksummed and archived, unless its GOOS/GOARCH is in Config.UPX.Skip.
+	Compress bool `json:"compress,omitzero"`
 }
 
 // Build calls `go build` on the artifact in the srcDir and writes the output to outDir.
 //
-//	ex: err := bin.Build("src", "build")
-func (a *Artifact) Build(srcDir, outDir string) error {
+// ctx governs the lifetime of the underlying `go build` process; cancelling it
+// (eg. because a sibling artifact failed) kills the process instead of letting
+// it run to completion. logger is used instead of the package-level slog so
+// concurrent builds keep their output grouped by artifact. flags is the
+// already-template-expanded form of a.Flags, and env holds extra "KEY=VALUE"
+// entries appended to the build's environment.
+//
+//	ex: err := bin.Build(ctx, logger, "src", "build", flags, env)
+func (a *Artifact) Build(ctx context.Context, logger *slog.Logger, srcDir, outDir string, flags, env []string) error {
 
 	target := path.Join(outDir, a.Name)
 
 	// setup the base build flags of output and target
-	flags := []string{"build", "-o", target}
+	buildFlags := []string{"build", "-o", target}
 
 	// append any additional flags to the build command
-	flags = append(flags, a.Flags...)
+	buildFlags = append(buildFlags, flags...)
 
 	// create the build command unrolling our flags
-	cmd := exec.Command("go", flags...)
+	cmd := exec.CommandContext(ctx, "go", buildFlags...)
 	cmd.Dir = srcDir
 	cmd.Env = append(os.Environ(),
 		"GOOS="+a.OS,
 		"GOARCH="+a.ARCH,
 	)
+	cmd.Env = append(cmd.Env, env...)
 
 	// if cgo is enabled, set the env var
 	if a.CGOEnabled {
 		cmd.Env = append(cmd.Env, "CGO_ENABLED=1")
-		slog.Info("executing", "GOOS", a.OS, "GOARCH", a.ARCH, "CGO_ENABLED", a.CGOEnabled, "cmd", cmd.String())
+		logger.Info("executing", "GOOS", a.OS, "GOARCH", a.ARCH, "CGO_ENABLED", a.CGOEnabled, "cmd", cmd.String())
 	} else {
-		slog.Info("executing", "GOOS", a.OS, "GOARCH", a.ARCH, "cmd", cmd.String())
+		logger.Info("executing", "GOOS", a.OS, "GOARCH", a.ARCH, "cmd", cmd.String())
 	}
 
 	err := cmd.Run()
@@ -59,80 +79,52 @@ func (a *Artifact) Build(srcDir, outDir string) error {
 	return nil
 }
 
-// CreateSumFile creates a checksum file for the given artifact.
+// WriteSumRecord writes a precomputed sum to filename in the gnu core
+// text/utilities format (eg. 'abc123 myfile'), without hashing artifact
+// again, eg. reusing a build-cache hit.
 //
-//	ex: err := bin.CreateSumFile(sha256.New(), artifact, "example.sha256.txt")
-func (b *Artifact) CreateSumFile(h hash.Hash, artifact, filename string) error {
+//	ex: err := bin.WriteSumRecord(sum, "example.sha256.txt")
+func (b *Artifact) WriteSumRecord(sum, filename string) error {
+	record := fmt.Sprintf("%s %s\n", sum, b.Name)
+	if err := os.WriteFile(filename, []byte(record), 0644); err != nil {
+		return fmt.Errorf("error writing sum file %s: %w", filename, err)
+	}
+	return nil
+}
+
+// sumFile returns the hex-encoded hash of path using h.
+func sumFile(h hash.Hash, path string) (string, error) {
 
-	// open the artifact binary
-	file, err := os.Open(artifact)
+	file, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("error opening artifact %s: %w", artifact, err)
+		return "", fmt.Errorf("error opening file %s: %w", path, err)
 	}
 	defer file.Close()
 
-	// populate the hash with the file contents
 	if _, err := io.Copy(h, file); err != nil {
-		return fmt.Errorf("error hashing file %s: %w", artifact, err)
+		return "", fmt.Errorf("error hashing file %s: %w", path, err)
 	}
 
-	// flush out a sum of the file
-	sum := h.Sum(nil)
-
-	// follow the format the gnu core text/utilities use; eg: 'abc123 myfile'
-	record := fmt.Sprintf("%x %s\n", sum, b.Name) // we use the name, not the location
-
-	// write the line record to our sum file
-	err = os.WriteFile(filename, []byte(record), 0644)
-	if err != nil {
-		return fmt.Errorf("error writing sum file %s: %w", filename, err)
-	}
-
-	return nil
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
 
-// CreatZipFile creates a zip archive as filename with the contents of artifact.
+// CreateArchive packs entries into filename using archiver.
 //
-// The artifact that is added to the zip will be at the root
-// so that it can be unzipped and run from the same directory.
+// The artifact binary is expected to be one of entries, at the root of the
+// archive, so that it can be extracted and run from the same directory.
 //
-//	ex: err := bin.CreatZipFile("build/example.exe", "example.zip")
-func (b *Artifact) CreatZipFile(artifact, filename string) error {
-
-	// create the zip file
-	zipFile, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("error creating zipfile %s: %w", filename, err)
-	}
-	defer zipFile.Close()
-
-	// create a new zip writer for the zip file
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
-
-	// open the artifact file as data
-	artifactData, err := os.Open(artifact)
-	if err != nil {
-		return fmt.Errorf("error opening artifact %s: %w", artifact, err)
-	}
-	defer artifactData.Close()
-
-	// create a new zip header for the artifact
-	header := &zip.FileHeader{
-		Name:   filepath.Base(artifact),
-		Method: zip.Deflate,
-	}
-	header.SetMode(0755) // make the artifact executable for unix-likes
+//	ex: err := bin.CreateArchive(ZipArchiver{}, entries, "example.zip")
+func (b *Artifact) CreateArchive(archiver Archiver, entries []ArchiveEntry, filename string) error {
 
-	// create a new zip entry for the artifact using our header
-	artifactEntry, err := zipWriter.CreateHeader(header)
+	// create the archive file
+	archiveFile, err := os.Create(filename)
 	if err != nil {
-		return fmt.Errorf("error creating zip entry %s: %w", artifact, err)
+		return fmt.Errorf("error creating archive %s: %w", filename, err)
 	}
+	defer archiveFile.Close()
 
-	// copy the artifact to the zip entry
-	if _, err := io.Copy(artifactEntry, artifactData); err != nil {
-		return fmt.Errorf("error copying artifact to zip %s: %w", artifact, err)
+	if err := archiver.Write(archiveFile, entries); err != nil {
+		return fmt.Errorf("error writing archive %s: %w", filename, err)
 	}
 
 	return nil
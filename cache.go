@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheMetadata is the small JSON sidecar stored next to a cached binary.
+type CacheMetadata struct {
+	Name      string            `json:"name"`
+	GoVersion string            `json:"goVersion"`
+	CreatedAt string            `json:"createdAt"`
+	Sums      map[string]string `json:"sums,omitzero"` // algo -> hex sum of the raw build output
+}
+
+// cacheEntryDir returns CacheDir/<key>, the directory holding one cached build.
+func cacheEntryDir(cacheDir, key string) string {
+	return filepath.Join(cacheDir, key)
+}
+
+// cacheKey computes a content-addressed key over srcDir's Go sources, the
+// target platform, cgo setting, build environment, un-expanded build flags,
+// resolved template metadata and the toolchain version, so a hit means
+// "go build would produce byte-identical output".
+//
+// The flags are hashed before template expansion, but tmplCtx (the data
+// that expansion draws on) is folded in separately with BuildDate cleared:
+// BuildDate is time.Now() on every invocation and would otherwise defeat
+// the cache for any flag that embeds it, while the rest of tmplCtx (Version,
+// Commit, Dirty, ...) must still invalidate the cache when the checkout
+// changes, even for flags whose template expansion only happens to be a
+// no-op today.
+//
+//	ex: key, err := cacheKey(config.SrcDir, config, artifact, tmplCtx)
+func cacheKey(srcDir string, config *Config, artifact Artifact, tmplCtx TemplateContext) (string, error) {
+
+	sourceHashes, err := sourceFileHashes(srcDir)
+	if err != nil {
+		return "", fmt.Errorf("error hashing sources in %s: %w", srcDir, err)
+	}
+
+	h := sha256.New()
+	for _, sourceHash := range sourceHashes {
+		io.WriteString(h, sourceHash)
+		io.WriteString(h, "\n")
+	}
+	io.WriteString(h, artifact.OS+"\n")
+	io.WriteString(h, artifact.ARCH+"\n")
+	io.WriteString(h, strconv.FormatBool(artifact.CGOEnabled)+"\n")
+	for _, flag := range artifact.Flags {
+		io.WriteString(h, flag+"\n")
+	}
+
+	env := buildEnv(config, artifact)
+	sort.Strings(env)
+	for _, entry := range env {
+		io.WriteString(h, entry+"\n")
+	}
+
+	tmplCtx.BuildDate = ""
+	tmplCtxJSON, err := json.Marshal(tmplCtx)
+	if err != nil {
+		return "", fmt.Errorf("error encoding template context: %w", err)
+	}
+	h.Write(tmplCtxJSON)
+	io.WriteString(h, "\n")
+
+	io.WriteString(h, runtime.Version()+"\n")
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// sourceFileHashes walks srcDir and returns a sorted "sum  path" line per
+// .go/go.mod/go.sum file, skipping vendor and hidden directories.
+func sourceFileHashes(srcDir string) ([]string, error) {
+
+	var lines []string
+
+	err := filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if path != srcDir && (d.Name() == "vendor" || strings.HasPrefix(d.Name(), ".")) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if !isCacheableSourceFile(d.Name()) {
+			return nil
+		}
+
+		sum, err := sumFile(sha256.New(), path)
+		if err != nil {
+			return err
+		}
+
+		lines = append(lines, sum+"  "+path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(lines)
+	return lines, nil
+}
+
+// isCacheableSourceFile reports whether name should contribute to the cache key.
+func isCacheableSourceFile(name string) bool {
+	return strings.HasSuffix(name, ".go") || name == "go.mod" || name == "go.sum"
+}
+
+// cacheLookup returns the metadata for key if both the cached binary and its
+// metadata exist.
+func cacheLookup(cacheDir, key string, artifact Artifact) (CacheMetadata, bool) {
+
+	entryDir := cacheEntryDir(cacheDir, key)
+
+	if _, err := os.Stat(filepath.Join(entryDir, artifact.Name)); err != nil {
+		return CacheMetadata{}, false
+	}
+
+	data, err := os.ReadFile(filepath.Join(entryDir, "metadata.json"))
+	if err != nil {
+		return CacheMetadata{}, false
+	}
+
+	var meta CacheMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return CacheMetadata{}, false
+	}
+
+	return meta, true
+}
+
+// cacheRestore copies (or hardlinks) the cached binary for key into artifactFile.
+//
+// Artifacts with Compress set are always copied, never hardlinked: upx
+// packs the binary in place, and packing a hardlink would corrupt the
+// cache entry it shares an inode with.
+func cacheRestore(cacheDir, key string, artifact Artifact, artifactFile string) error {
+	src := filepath.Join(cacheEntryDir(cacheDir, key), artifact.Name)
+	if artifact.Compress {
+		return copyFile(src, artifactFile)
+	}
+	return linkOrCopyFile(src, artifactFile)
+}
+
+// cacheStore saves artifactFile and its known sums under key for future runs.
+//
+// Artifacts with Compress set are always copied, never hardlinked: upx
+// packs artifactFile in place on a later run, which would otherwise mutate
+// this cache entry's bytes out from under it.
+func cacheStore(cacheDir, key string, artifact Artifact, artifactFile string, sums map[string]string) error {
+
+	entryDir := cacheEntryDir(cacheDir, key)
+	if err := os.MkdirAll(entryDir, 0755); err != nil {
+		return fmt.Errorf("error creating cache entry %s: %w", entryDir, err)
+	}
+
+	dst := filepath.Join(entryDir, artifact.Name)
+	storeFile := linkOrCopyFile
+	if artifact.Compress {
+		storeFile = copyFile
+	}
+	if err := storeFile(artifactFile, dst); err != nil {
+		return err
+	}
+
+	meta := CacheMetadata{
+		Name:      artifact.Name,
+		GoVersion: runtime.Version(),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Sums:      sums,
+	}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding cache metadata: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(entryDir, "metadata.json"), data, 0644); err != nil {
+		return fmt.Errorf("error writing cache metadata: %w", err)
+	}
+
+	return nil
+}
+
+// linkOrCopyFile hardlinks src to dst, falling back to a full copy when
+// linking isn't possible (eg. across filesystems), preserving src's mode.
+func linkOrCopyFile(src, dst string) error {
+
+	os.Remove(dst) // clobber whatever's already there, same as os.Create would
+
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	return copyFile(src, dst)
+}
+
+// copyFile copies src to dst byte-for-byte, preserving src's mode. Unlike
+// linkOrCopyFile it never hardlinks, for callers where dst may later be
+// mutated in place (eg. upx compression) and must not share an inode with src.
+func copyFile(src, dst string) error {
+
+	os.Remove(dst) // clobber whatever's already there, same as os.Create would
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("error statting %s: %w", src, err)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", dst, err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("error copying %s to %s: %w", src, dst, err)
+	}
+
+	return nil
+}
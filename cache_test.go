@@ -0,0 +1,163 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestSrcDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestCacheKeyStableAcrossBuildDate(t *testing.T) {
+	srcDir := newTestSrcDir(t)
+	config := &Config{}
+	artifact := Artifact{Name: "example", OS: "linux", ARCH: "amd64", Flags: []string{"-X main.date={{.BuildDate}}"}}
+
+	key1, err := cacheKey(srcDir, config, artifact, TemplateContext{BuildDate: "2026-01-01T00:00:00Z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key2, err := cacheKey(srcDir, config, artifact, TemplateContext{BuildDate: "2026-02-02T00:00:00Z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key1 != key2 {
+		t.Errorf("expected cache key to ignore BuildDate, got %s != %s", key1, key2)
+	}
+}
+
+func TestCacheKeyInvalidatesOnTemplateMetadata(t *testing.T) {
+	srcDir := newTestSrcDir(t)
+	config := &Config{}
+	artifact := Artifact{Name: "example", OS: "linux", ARCH: "amd64", Flags: []string{"-X main.version={{.Version}}"}}
+
+	key1, err := cacheKey(srcDir, config, artifact, TemplateContext{Version: "v1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key2, err := cacheKey(srcDir, config, artifact, TemplateContext{Version: "v2.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key1 == key2 {
+		t.Errorf("expected cache key to change with Version, got the same key %s for both", key1)
+	}
+}
+
+func TestCacheKeyInvalidatesOnFlagsAndEnv(t *testing.T) {
+	srcDir := newTestSrcDir(t)
+	artifact := Artifact{Name: "example", OS: "linux", ARCH: "amd64"}
+	tmplCtx := TemplateContext{}
+
+	base, err := cacheKey(srcDir, &Config{}, artifact, tmplCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withFlag := artifact
+	withFlag.Flags = []string{"-ldflags=-s -w"}
+	keyWithFlag, err := cacheKey(srcDir, &Config{}, withFlag, tmplCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base == keyWithFlag {
+		t.Error("expected cache key to change when Flags change")
+	}
+
+	withEnv := artifact
+	withEnv.Env = map[string]string{"CGO_CFLAGS": "-O2"}
+	keyWithEnv, err := cacheKey(srcDir, &Config{}, withEnv, tmplCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base == keyWithEnv {
+		t.Error("expected cache key to change when build env changes")
+	}
+}
+
+func TestCacheStoreLookupRestoreRoundTrip(t *testing.T) {
+	cacheDir := t.TempDir()
+	artifact := Artifact{Name: "example"}
+	key := "deadbeef"
+	sums := map[string]string{"sha256": "abc123"}
+
+	buildDir := t.TempDir()
+	artifactFile := filepath.Join(buildDir, artifact.Name)
+	if err := os.WriteFile(artifactFile, []byte("binary contents"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cacheStore(cacheDir, key, artifact, artifactFile, sums); err != nil {
+		t.Fatalf("cacheStore: %v", err)
+	}
+
+	meta, ok := cacheLookup(cacheDir, key, artifact)
+	if !ok {
+		t.Fatal("expected cacheLookup to find the entry just stored")
+	}
+	if meta.Sums["sha256"] != "abc123" {
+		t.Errorf("expected stored sums to round-trip, got %v", meta.Sums)
+	}
+
+	restoreFile := filepath.Join(t.TempDir(), artifact.Name)
+	if err := cacheRestore(cacheDir, key, artifact, restoreFile); err != nil {
+		t.Fatalf("cacheRestore: %v", err)
+	}
+
+	got, err := os.ReadFile(restoreFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "binary contents" {
+		t.Errorf("expected restored contents to match the stored artifact, got %q", got)
+	}
+
+	if _, ok := cacheLookup(cacheDir, "not-a-real-key", artifact); ok {
+		t.Error("expected cacheLookup to miss for an unknown key")
+	}
+}
+
+func TestCacheStoreRestoreCopiesWhenCompressed(t *testing.T) {
+	cacheDir := t.TempDir()
+	artifact := Artifact{Name: "example", Compress: true}
+	key := "deadbeef"
+
+	buildDir := t.TempDir()
+	artifactFile := filepath.Join(buildDir, artifact.Name)
+	if err := os.WriteFile(artifactFile, []byte("binary contents"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cacheStore(cacheDir, key, artifact, artifactFile, nil); err != nil {
+		t.Fatalf("cacheStore: %v", err)
+	}
+
+	restoreFile := filepath.Join(t.TempDir(), artifact.Name)
+	if err := cacheRestore(cacheDir, key, artifact, restoreFile); err != nil {
+		t.Fatalf("cacheRestore: %v", err)
+	}
+
+	cached := filepath.Join(cacheEntryDir(cacheDir, key), artifact.Name)
+	restoredInfo, err := os.Stat(restoreFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cachedInfo, err := os.Stat(cached)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(restoredInfo, cachedInfo) {
+		t.Error("expected a compressed artifact to be copied from the cache, not hardlinked")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -12,11 +13,44 @@ type Config struct {
 	OutDir string `json:"outDir"`
 	SrcDir string `json:"srcDir"`
 
-	MD5     bool `json:"md5"`
-	SHA1    bool `json:"sha1"`
-	SHA256  bool `json:"sha256"`
-	SHA512  bool `json:"sha512"`
-	ZipFile bool `json:"zipFile"`
+	MD5    bool `json:"md5"`
+	SHA1   bool `json:"sha1"`
+	SHA256 bool `json:"sha256"`
+	SHA512 bool `json:"sha512"`
+
+	// Archives lists the archive formats to produce for each artifact, eg.
+	// ["zip","tar.gz","tar.zst"]. An Artifact may override this list.
+	Archives []string `json:"archives,omitzero"`
+
+	// ExtraFiles are bundled into every archive alongside the binary, eg.
+	// README.md or LICENSE. Paths are resolved relative to SrcDir.
+	ExtraFiles []string `json:"extraFiles,omitzero"`
+
+	// Parallelism caps how many artifacts build concurrently. 0 means use
+	// runtime.GOMAXPROCS(0).
+	Parallelism int `json:"parallelism,omitzero"`
+
+	// Sign optionally GPG-signs artifacts, archives and checksum manifests.
+	Sign SignConfig `json:"sign,omitzero"`
+
+	// UPX configures the optional post-build compression pass used by
+	// artifacts with Compress set.
+	UPX UPXConfig `json:"upx,omitzero"`
+
+	// Env holds extra build-time environment variables applied to every
+	// artifact, eg. for private module proxies. An Artifact's own Env
+	// overrides these on conflicts.
+	Env map[string]string `json:"env,omitzero"`
+
+	// CacheDir is where built binaries are cached, keyed on source content,
+	// toolchain and flags. Empty means $XDG_CACHE_HOME/go-cross-compile.
+	CacheDir string `json:"cacheDir,omitzero"`
+
+	// noCache disables cache reads and writes for this run, and
+	// resolvedCacheDir caches the result of ResolveCacheDir; both are set at
+	// runtime from the --no-cache flag rather than the config file.
+	noCache          bool
+	resolvedCacheDir string
 
 	Artifacts []Artifact `json:"artifacts"`
 }
@@ -24,17 +58,53 @@ type Config struct {
 // NewConfig returns a new Config with default values
 func NewConfig() *Config {
 	return &Config{
-		OutDir:    "build",
-		SrcDir:    ".",
-		MD5:       false,
-		SHA1:      true,
-		SHA256:    false,
-		SHA512:    false,
-		ZipFile:   false,
-		Artifacts: []Artifact{},
+		OutDir:      "build",
+		SrcDir:      ".",
+		MD5:         false,
+		SHA1:        true,
+		SHA256:      false,
+		SHA512:      false,
+		Archives:    []string{},
+		ExtraFiles:  []string{},
+		Env:         map[string]string{},
+		Parallelism: 0,
+		Artifacts:   []Artifact{},
 	}
 }
 
+// ResolveCacheDir returns CacheDir, defaulting to
+// $XDG_CACHE_HOME/go-cross-compile (or ~/.cache/go-cross-compile).
+//
+//	ex: cacheDir, err := myconfig.ResolveCacheDir()
+func (c *Config) ResolveCacheDir() (string, error) {
+	if c.CacheDir != "" {
+		return c.CacheDir, nil
+	}
+
+	base := os.Getenv("XDG_CACHE_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".cache")
+	}
+
+	return filepath.Join(base, "go-cross-compile"), nil
+}
+
+// FindArtifact returns the artifact with the given name, eg. for --print-env.
+//
+//	ex: artifact, ok := myconfig.FindArtifact("example-linux-amd64")
+func (c *Config) FindArtifact(name string) (Artifact, bool) {
+	for _, artifact := range c.Artifacts {
+		if artifact.Name == name {
+			return artifact, true
+		}
+	}
+	return Artifact{}, false
+}
+
 // AddBuild adds a build target group for Go binaries.
 //
 //	ex: myconfig.AddBuild("example.exe", "windows", "amd64")
@@ -77,9 +147,32 @@ func (c *Config) Load(filename string) error {
 	if err != nil {
 		return err
 	}
+
+	c.migrateLegacyZipFile(data)
+
 	return nil
 }
 
+// migrateLegacyZipFile warns about the "zipFile" bool option removed when
+// Archives was introduced, and honors it as Archives: ["zip"] when Archives
+// wasn't otherwise set, so configs written before that change don't silently
+// stop producing release archives.
+func (c *Config) migrateLegacyZipFile(data []byte) {
+	var legacy struct {
+		ZipFile *bool `json:"zipFile"`
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil || legacy.ZipFile == nil {
+		return
+	}
+
+	slog.Warn("config uses removed \"zipFile\" option, use \"archives\" instead", "zipFile", *legacy.ZipFile)
+
+	if *legacy.ZipFile && len(c.Archives) == 0 {
+		c.Archives = []string{"zip"}
+		slog.Warn("honoring legacy zipFile as archives", "archives", c.Archives)
+	}
+}
+
 // RunChecks performs some basic checks on the config to catch gotchas.
 //
 //	ex: myconfig.RunChecks()
@@ -90,4 +183,9 @@ func (c *Config) RunChecks() {
 			slog.Warn("arch not found in artifact name", "artifact", artifact.Name, "arch", artifact.ARCH)
 		}
 	}
+
+	// check signing is configured if it was asked for
+	if (c.Sign.SignArtifacts || c.Sign.SignSums) && c.Sign.GPGKeyID == "" {
+		slog.Warn("signing enabled without a gpgKeyId", "signArtifacts", c.Sign.SignArtifacts, "signSums", c.Sign.SignSums)
+	}
 }
@@ -14,5 +14,29 @@ const (
 	ErrorSHA1SumFile               // 10 - error creating SHA1 checksum file
 	ErrorSHA256SumFile             // 11 - error creating SHA256 checksum file
 	ErrorSHA512SumFile             // 12 - error creating SHA512 checksum file
-	ErrorZipFile                   // 13 - error creating zip file
+	ErrorArchiveFile               // 13 - error creating archive file
+	ErrorSumsManifest              // 14 - error writing combined checksum manifest
+	ErrorSignFailed                // 15 - error signing an artifact or checksum manifest
+	ErrorUPXMissing                // 16 - upx binary not found but compression was requested
+	ErrorUPXCompress               // 17 - error running upx against an artifact
+	ErrorFlagsTemplate             // 18 - error expanding a templated build flag
+	ErrorCache                     // 19 - error reading or writing the build cache
 )
+
+// CodeError pairs an underlying error with the exit code it should map to.
+//
+// Artifact builds now run concurrently, so the goroutine that fails first
+// needs a way to carry its exit code back through errgroup to run(), which
+// no longer knows which stage produced the error just by looking at it.
+type CodeError struct {
+	Code int
+	Err  error
+}
+
+func (e *CodeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CodeError) Unwrap() error {
+	return e.Err
+}
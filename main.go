@@ -1,32 +1,42 @@
 package main
 
 import (
+	"context"
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
 	"runtime/debug"
 	"time"
+
+	"golang.org/x/sync/errgroup"
 )
 
 var argConfigFile = flag.String("config-file", "go-cross-compile.json", "config file to use")
 var argInitConfig = flag.Bool("init-config", false, "initialize a new config file and exit")
 var argVersion = flag.Bool("version", false, "emit version and build info and exit")
+var argPrintEnv = flag.String("print-env", "", "print the resolved template context for the named artifact and exit")
+var argNoCache = flag.Bool("no-cache", false, "bypass the build cache for this run")
+var argCachePrune = flag.Bool("cache-prune", false, "remove the build cache directory and exit")
 
 func usage() {
 	println(`Usage: [go tool] go-cross-compile [options]
 This tool was inspired from the tedious task of cross compiling go binaries and
-hash sums. The md5, sha1, sha256, sha512 and zip options are available for each 
-artifact of the operation.
+hash sums. The md5, sha1, sha256, sha512 and archives options are available for
+each artifact of the operation.
 
   - $outDir/$name per artifact member of artifacts defined in the config
   - $outDir/$name.$mode.txt for each of md5, sha1, sha256 or sha512 when enabled
-  - $outDir/$name.zip containing the artifact per build when enabled
+  - $outDir/$name.$ext per archive format (zip, tar.gz, tar.zst) when enabled
 
 Workflow:
 
@@ -34,13 +44,16 @@ Workflow:
   2. edit the config file 'go-cross-compile.json' to your liking
   3. create the outDir ex: 'mkdir build' (this is a kind of safety check)
   4. run 'go-cross-compile --config-file go-cross-compile.json' to have Go build
-	 the artifacts and create the hash sums and zip files
+	 the artifacts and create the hash sums and archives
 
 Tips:
   - 'go tool dist list' will show the valid GOOS and GOARCH values
-  - the zip files will contain the artifact at the root of the tree
+  - the archives will contain the artifact at the root of the tree
+  - extraFiles in the config (eg. README, LICENSE) are bundled into archives too
   - the hash sum text files are compatible with the gnu core text utilities
   - the argument --version will emit debug metadata of the tool itself
+  - built artifacts are cached by source, platform and flags; use --no-cache
+	to bypass the cache for a run, or --cache-prune to clear it
   - the tool will exit with a non-zero status on error
 
 Options:`)
@@ -110,103 +123,334 @@ func run() int {
 	// run some basic checks on the config
 	config.RunChecks()
 
+	// remove the build cache directory and exit
+	if *argCachePrune {
+		cacheDir, err := config.ResolveCacheDir()
+		if err != nil {
+			slog.Error("error resolving cache dir", "error", err)
+			return ErrorCache
+		}
+
+		if err := os.RemoveAll(cacheDir); err != nil {
+			slog.Error("error removing cache dir", "cacheDir", cacheDir, "error", err)
+			return ErrorCache
+		}
+		slog.Info("removed cache dir", "cacheDir", cacheDir)
+
+		return NoError
+	}
+
 	// check the srcDir exists
 	if _, err := os.Stat(config.SrcDir); os.IsNotExist(err) {
 		slog.Error("srcDir does not exist", "srcDir", config.SrcDir)
 		return ErrorSrcDirNotFound
 	}
 
+	// print the resolved template context for one artifact and exit
+	if *argPrintEnv != "" {
+		artifact, found := config.FindArtifact(*argPrintEnv)
+		if !found {
+			slog.Error("artifact not found", "name", *argPrintEnv)
+			return ErrorUnknown
+		}
+
+		tmplCtx, err := buildTemplateContext(context.Background(), config.SrcDir, artifact)
+		if err != nil {
+			slog.Error("error resolving template context", "error", err)
+			return ErrorFlagsTemplate
+		}
+
+		data, err := json.MarshalIndent(tmplCtx, "", "  ")
+		if err != nil {
+			slog.Error("error encoding template context", "error", err)
+			return ErrorUnknown
+		}
+		fmt.Println(string(data))
+
+		return NoError
+	}
+
 	// check the outDir exists
 	if _, err := os.Stat(config.OutDir); os.IsNotExist(err) {
 		slog.Error("outDir does not exist", "outDir", config.OutDir)
 		return ErrorOutDirNotFound
 	}
 
+	// fail fast if compression was requested but upx isn't installed
+	if anyCompressionRequested(config) {
+		if _, err := exec.LookPath(config.UPX.path()); err != nil {
+			slog.Error("upx binary not found", "path", config.UPX.path(), "error", err)
+			return ErrorUPXMissing
+		}
+	}
+
+	// resolve the build cache directory up front so every artifact shares it
+	config.noCache = *argNoCache
+	if !config.noCache {
+		resolvedCacheDir, err := config.ResolveCacheDir()
+		if err != nil {
+			slog.Error("error resolving cache dir", "error", err)
+			return ErrorCache
+		}
+		config.resolvedCacheDir = resolvedCacheDir
+	}
+
 	// clock the overall operation until the end
 	startOperation := time.Now()
 
 	slog.Info("building artifact", "srcDir", config.SrcDir, "outDir", config.OutDir)
 
-	// iterate over the artifacts and call their build function
+	// a failure in one artifact cancels the go build processes of the rest
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// gctx is only for the artifact goroutines below: errgroup cancels it the
+	// moment g.Wait() returns (success or failure), so anything that needs to
+	// keep running after g.Wait(), like signing the sums manifest, must use
+	// ctx instead or it'll hand exec.CommandContext an already-canceled context.
+	g, gctx := errgroup.WithContext(ctx)
+
+	limit := config.Parallelism
+	if limit <= 0 {
+		limit = runtime.GOMAXPROCS(0)
+	}
+	g.SetLimit(limit)
+
+	// collects checksum records from every artifact for the combined manifest
+	manifest := NewSumManifest()
+
+	// run each artifact's build+sum+archive pipeline on the worker pool
 	for _, artifact := range config.Artifacts {
+		artifact := artifact
+		g.Go(func() error {
+			return buildArtifact(gctx, config, artifact, manifest)
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		var codeErr *CodeError
+		if errors.As(err, &codeErr) {
+			slog.Error("error building artifacts", "error", codeErr.Err)
+			return codeErr.Code
+		}
+		slog.Error("error building artifacts", "error", err)
+		return ErrorUnknown
+	}
+
+	// write the combined SHA256SUMS (and sibling) manifests, then sign them
+	if err := manifest.Write(config.OutDir); err != nil {
+		slog.Error("error writing sums manifest", "error", err)
+		return ErrorSumsManifest
+	}
+
+	if config.Sign.SignSums {
+		for _, sumsFile := range manifest.Filenames(config.OutDir) {
+			if err := config.Sign.SignFile(ctx, slog.Default(), sumsFile); err != nil {
+				slog.Error("error signing sums manifest", "error", err)
+				return ErrorSignFailed
+			}
+			slog.Info("signed sums manifest", "sumsFile", sumsFile)
+		}
+	}
+
+	slog.Info("operation complete", "duration", time.Since(startOperation))
+	return NoError
+}
+
+// buildArtifact runs the full build, checksum and archive pipeline for a
+// single artifact, grouping its log output under an "artifact" attribute so
+// concurrent builds stay readable when interleaved.
+//
+// Any failure is wrapped in a CodeError carrying the exit code run() should
+// surface, since the caller can no longer infer it from which stage failed.
+// Checksums are folded into manifest as they're computed, for the combined
+// SHA256SUMS (and sibling) files run() writes once every artifact is done.
+//
+// Unless config.noCache, the build cache is consulted before invoking `go
+// build`: a hit restores the previous binary and its checksums instead of
+// rebuilding, and a miss stores the freshly built binary for next time.
+// Checksums are only reused from the cache when nothing downstream (eg. upx
+// compression) has mutated the binary since; signing writes a separate
+// path+".asc" file and never touches artifactFile itself.
+func buildArtifact(ctx context.Context, config *Config, artifact Artifact, manifest *SumManifest) error {
+
+	logger := slog.With("artifact", artifact.Name)
+
+	// expand {{.Version}}-style templates in Flags with git/version metadata
+	tmplCtx, err := buildTemplateContext(ctx, config.SrcDir, artifact)
+	if err != nil {
+		return &CodeError{Code: ErrorFlagsTemplate, Err: fmt.Errorf("error resolving template context: %w", err)}
+	}
+
+	flags, err := resolveFlags(artifact.Flags, tmplCtx)
+	if err != nil {
+		return &CodeError{Code: ErrorFlagsTemplate, Err: fmt.Errorf("error resolving flags: %w", err)}
+	}
 
+	artifactFile := fmt.Sprintf("%s/%s", config.OutDir, artifact.Name)
+
+	// a cache hit restores the raw build output (and its checksums) instead
+	// of invoking `go build` again
+	var haveRawSums bool
+	var rawSums map[string]string
+
+	key, err := cacheKey(config.SrcDir, config, artifact, tmplCtx)
+	if err != nil {
+		return &CodeError{Code: ErrorCache, Err: fmt.Errorf("error computing cache key: %w", err)}
+	}
+
+	cacheHit := false
+	if !config.noCache {
+		if meta, ok := cacheLookup(config.resolvedCacheDir, key, artifact); ok {
+			if err := cacheRestore(config.resolvedCacheDir, key, artifact, artifactFile); err != nil {
+				return &CodeError{Code: ErrorCache, Err: fmt.Errorf("error restoring cached artifact: %w", err)}
+			}
+			cacheHit = true
+			haveRawSums = true
+			rawSums = meta.Sums
+			logger.Info("cache hit", "cacheKey", key)
+		}
+	}
+
+	if !cacheHit {
 		// clock the build time
 		start := time.Now()
 
 		// build the artifact
-		err := artifact.Build(config.SrcDir, config.OutDir)
-		if err != nil {
-			slog.Error("error building artifact", "error", err)
-			return ErrorGoBuild
+		if err := artifact.Build(ctx, logger, config.SrcDir, config.OutDir, flags, buildEnv(config, artifact)); err != nil {
+			return &CodeError{Code: ErrorGoBuild, Err: fmt.Errorf("error building artifact: %w", err)}
 		}
 
-		slog.Info("built", "artifact", artifact.Name, "duration", time.Since(start))
-
-		artifactFile := fmt.Sprintf("%s/%s", config.OutDir, artifact.Name)
+		logger.Info("built", "duration", time.Since(start))
 
-		// create md5 hash if requested
-		if config.MD5 {
-			sumFile := fmt.Sprintf("%s/%s.%s.txt", config.OutDir, artifact.Name, "md5")
-			err := artifact.CreateSumFile(md5.New(), artifactFile, sumFile)
+		if !config.noCache {
+			sums, err := computeEnabledSums(config, artifactFile)
 			if err != nil {
-				slog.Error("error creating md5", "error", err)
-				return ErrorMD5SumFile
+				return &CodeError{Code: ErrorCache, Err: fmt.Errorf("error summing artifact for cache: %w", err)}
 			}
 
-			slog.Info("created md5", "sumFile", sumFile)
+			if err := cacheStore(config.resolvedCacheDir, key, artifact, artifactFile, sums); err != nil {
+				return &CodeError{Code: ErrorCache, Err: fmt.Errorf("error storing cached artifact: %w", err)}
+			}
+			haveRawSums = true
+			rawSums = sums
+			logger.Info("cached artifact", "cacheKey", key)
 		}
+	}
 
-		// create sha1 hash if requested
-		if config.SHA1 {
-			sumFile := fmt.Sprintf("%s/%s.%s.txt", config.OutDir, artifact.Name, "sha1")
-			err := artifact.CreateSumFile(sha1.New(), artifactFile, sumFile)
-			if err != nil {
-				slog.Error("error creating sha1", "error", err)
-				return ErrorSHA1SumFile
-			}
+	// mutated tracks whether artifactFile has changed since it held the raw
+	// build output, which invalidates rawSums for the final checksum files
+	mutated := false
+
+	if artifact.Compress {
+		if config.UPX.skips(artifact.OS, artifact.ARCH) {
+			logger.Info("skipping upx compression", "GOOS", artifact.OS, "GOARCH", artifact.ARCH)
+		} else if err := config.UPX.Compress(ctx, logger, artifactFile); err != nil {
+			return &CodeError{Code: ErrorUPXCompress, Err: fmt.Errorf("error compressing artifact: %w", err)}
+		} else {
+			mutated = true
+		}
+	}
 
-			slog.Info("created sha1", "sumFile", sumFile)
+	if config.Sign.SignArtifacts {
+		if err := config.Sign.SignFile(ctx, logger, artifactFile); err != nil {
+			return &CodeError{Code: ErrorSignFailed, Err: fmt.Errorf("error signing artifact: %w", err)}
 		}
+		logger.Info("signed artifact", "artifactFile", artifactFile)
+	}
 
-		// create sha256 hash if requested
-		if config.SHA256 {
-			sumFile := fmt.Sprintf("%s/%s.%s.txt", config.OutDir, artifact.Name, "sha256")
-			err := artifact.CreateSumFile(sha256.New(), artifactFile, sumFile)
-			if err != nil {
-				slog.Error("error creating sha256", "error", err)
-				return ErrorSHA256SumFile
-			}
+	// create md5 hash if requested
+	if config.MD5 {
+		sumFile := fmt.Sprintf("%s/%s.%s.txt", config.OutDir, artifact.Name, "md5")
+		sum, err := sumOrCached(haveRawSums, mutated, rawSums, "md5", md5.New, artifactFile)
+		if err != nil {
+			return &CodeError{Code: ErrorMD5SumFile, Err: fmt.Errorf("error creating md5: %w", err)}
+		}
+		if err := artifact.WriteSumRecord(sum, sumFile); err != nil {
+			return &CodeError{Code: ErrorMD5SumFile, Err: fmt.Errorf("error creating md5: %w", err)}
+		}
+		manifest.Add("md5", sum, artifact.Name)
+
+		logger.Info("created md5", "sumFile", sumFile)
+	}
+
+	// create sha1 hash if requested
+	if config.SHA1 {
+		sumFile := fmt.Sprintf("%s/%s.%s.txt", config.OutDir, artifact.Name, "sha1")
+		sum, err := sumOrCached(haveRawSums, mutated, rawSums, "sha1", sha1.New, artifactFile)
+		if err != nil {
+			return &CodeError{Code: ErrorSHA1SumFile, Err: fmt.Errorf("error creating sha1: %w", err)}
+		}
+		if err := artifact.WriteSumRecord(sum, sumFile); err != nil {
+			return &CodeError{Code: ErrorSHA1SumFile, Err: fmt.Errorf("error creating sha1: %w", err)}
+		}
+		manifest.Add("sha1", sum, artifact.Name)
+
+		logger.Info("created sha1", "sumFile", sumFile)
+	}
 
-			slog.Info("created sha256", "sumFile", sumFile)
+	// create sha256 hash if requested
+	if config.SHA256 {
+		sumFile := fmt.Sprintf("%s/%s.%s.txt", config.OutDir, artifact.Name, "sha256")
+		sum, err := sumOrCached(haveRawSums, mutated, rawSums, "sha256", sha256.New, artifactFile)
+		if err != nil {
+			return &CodeError{Code: ErrorSHA256SumFile, Err: fmt.Errorf("error creating sha256: %w", err)}
+		}
+		if err := artifact.WriteSumRecord(sum, sumFile); err != nil {
+			return &CodeError{Code: ErrorSHA256SumFile, Err: fmt.Errorf("error creating sha256: %w", err)}
 		}
+		manifest.Add("sha256", sum, artifact.Name)
 
-		// create sha512 hash if requested
-		if config.SHA512 {
-			sumFile := fmt.Sprintf("%s/%s.%s.txt", config.OutDir, artifact.Name, "sha512")
-			err := artifact.CreateSumFile(sha512.New(), artifactFile, sumFile)
-			if err != nil {
-				slog.Error("error creating sha512", "error", err)
-				return ErrorSHA512SumFile
-			}
+		logger.Info("created sha256", "sumFile", sumFile)
+	}
 
-			slog.Info("created sha512", "sumFile", sumFile)
+	// create sha512 hash if requested
+	if config.SHA512 {
+		sumFile := fmt.Sprintf("%s/%s.%s.txt", config.OutDir, artifact.Name, "sha512")
+		sum, err := sumOrCached(haveRawSums, mutated, rawSums, "sha512", sha512.New, artifactFile)
+		if err != nil {
+			return &CodeError{Code: ErrorSHA512SumFile, Err: fmt.Errorf("error creating sha512: %w", err)}
 		}
+		if err := artifact.WriteSumRecord(sum, sumFile); err != nil {
+			return &CodeError{Code: ErrorSHA512SumFile, Err: fmt.Errorf("error creating sha512: %w", err)}
+		}
+		manifest.Add("sha512", sum, artifact.Name)
 
-		// create a zip archive of the artifact if requested
-		if config.ZipFile {
-			zipFile := fmt.Sprintf("%s/%s.zip", config.OutDir, artifact.Name)
-			err := artifact.CreatZipFile(artifactFile, zipFile)
-			if err != nil {
-				slog.Error("error creating zip archive", "error", err)
-				return ErrorZipFile
+		logger.Info("created sha512", "sumFile", sumFile)
+	}
+
+	// create the requested archives of the artifact (plus any extra files)
+	for _, kind := range archiveKinds(config, artifact) {
+		archiver, err := NewArchiver(kind)
+		if err != nil {
+			return &CodeError{Code: ErrorArchiveFile, Err: fmt.Errorf("error creating archive: %w", err)}
+		}
+
+		entries, err := archiveEntries(config, artifact, artifactFile)
+		if err != nil {
+			return &CodeError{Code: ErrorArchiveFile, Err: fmt.Errorf("error creating archive: %w", err)}
+		}
+
+		archiveFile := fmt.Sprintf("%s/%s.%s", config.OutDir, artifact.Name, archiver.Extension())
+		if err := artifact.CreateArchive(archiver, entries, archiveFile); err != nil {
+			return &CodeError{Code: ErrorArchiveFile, Err: fmt.Errorf("error creating archive: %w", err)}
+		}
+
+		logger.Info("created archive", "archiveFile", archiveFile)
+
+		if config.Sign.SignArtifacts {
+			if err := config.Sign.SignFile(ctx, logger, archiveFile); err != nil {
+				return &CodeError{Code: ErrorSignFailed, Err: fmt.Errorf("error signing archive: %w", err)}
 			}
+			logger.Info("signed archive", "archiveFile", archiveFile)
+		}
 
-			slog.Info("created archive", "zipFile", zipFile)
+		if err := addArchiveSums(config, manifest, archiveFile); err != nil {
+			return &CodeError{Code: ErrorSumsManifest, Err: fmt.Errorf("error summing archive: %w", err)}
 		}
 	}
 
-	slog.Info("operation complete", "duration", time.Since(startOperation))
-	return NoError
+	return nil
 }
 
 func VersionInfo() {
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// SignConfig controls optional GPG signing of release artifacts and checksum manifests.
+type SignConfig struct {
+	GPGPath       string `json:"gpgPath,omitzero"`
+	GPGKeyID      string `json:"gpgKeyId,omitzero"`
+	Passphrase    string `json:"passphrase,omitzero"`
+	PassphraseEnv string `json:"passphraseEnv,omitzero"`
+	SignArtifacts bool   `json:"signArtifacts,omitzero"`
+	SignSums      bool   `json:"signSums,omitzero"`
+}
+
+// path returns the configured gpg binary, defaulting to "gpg" on $PATH.
+func (s *SignConfig) path() string {
+	if s.GPGPath != "" {
+		return s.GPGPath
+	}
+	return "gpg"
+}
+
+// resolvePassphrase prefers PassphraseEnv over the literal Passphrase field
+// so secrets need not live in the config file itself.
+func (s *SignConfig) resolvePassphrase() string {
+	if s.PassphraseEnv != "" {
+		return os.Getenv(s.PassphraseEnv)
+	}
+	return s.Passphrase
+}
+
+// SignFile shells out to `gpg --detach-sign` to write an ascii-armored
+// detached signature for path to path+".asc".
+//
+// Signing goes through the gpg binary rather than a Go openpgp library so it
+// picks up gpg-agent, pinentry prompts and smartcard-backed keys the same
+// way a user's own `gpg --sign` would, instead of requiring the secret key
+// to be exported to a legacy secring.gpg file first.
+//
+//	ex: err := config.Sign.SignFile(ctx, logger, "build/example.exe")
+func (s *SignConfig) SignFile(ctx context.Context, logger *slog.Logger, path string) error {
+
+	args := []string{"--batch", "--yes", "--armor", "--detach-sign", "--output", path + ".asc"}
+
+	if s.GPGKeyID != "" {
+		args = append(args, "--local-user", s.GPGKeyID)
+	}
+
+	passphrase := s.resolvePassphrase()
+	if passphrase != "" {
+		args = append(args, "--pinentry-mode", "loopback", "--passphrase-fd", "0")
+	}
+
+	args = append(args, path)
+
+	cmd := exec.CommandContext(ctx, s.path(), args...)
+	if passphrase != "" {
+		cmd.Stdin = strings.NewReader(passphrase)
+	}
+
+	logger.Info("executing", "cmd", cmd.String())
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error signing %s: %w: %s", path, err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
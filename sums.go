@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// sumRecord is one line of a combined checksum manifest.
+type sumRecord struct {
+	sum  string
+	name string
+}
+
+// SumManifest accumulates checksum records per algorithm across every
+// artifact so a single combined SHA256SUMS (and sibling MD5SUMS/SHA1SUMS/
+// SHA512SUMS) can be written once all artifacts have finished building.
+//
+// Artifacts build concurrently, so adding a record is safe to call from
+// multiple goroutines.
+type SumManifest struct {
+	mu      sync.Mutex
+	records map[string][]sumRecord
+}
+
+// NewSumManifest returns an empty SumManifest.
+func NewSumManifest() *SumManifest {
+	return &SumManifest{records: make(map[string][]sumRecord)}
+}
+
+// Add records sum for name under the given hash algorithm, eg. "sha256".
+func (m *SumManifest) Add(algo, sum, name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[algo] = append(m.records[algo], sumRecord{sum: sum, name: name})
+}
+
+// Write emits one combined sums file per algorithm with records, eg.
+// "SHA256SUMS" for algo "sha256", in the gnu core text/utilities format.
+// Records are sorted by name first so the output is reproducible across
+// runs even though artifacts build out of order.
+//
+//	ex: err := manifest.Write("build")
+func (m *SumManifest) Write(outDir string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for algo, records := range m.records {
+		sort.Slice(records, func(i, j int) bool { return records[i].name < records[j].name })
+
+		var data []byte
+		for _, record := range records {
+			data = append(data, fmt.Sprintf("%s %s\n", record.sum, record.name)...)
+		}
+
+		filename := filepath.Join(outDir, strings.ToUpper(algo)+"SUMS")
+		if err := os.WriteFile(filename, data, 0644); err != nil {
+			return fmt.Errorf("error writing sums manifest %s: %w", filename, err)
+		}
+	}
+
+	return nil
+}
+
+// hashKind pairs an algorithm name with whether it's enabled and how to
+// construct a fresh hash.Hash for it.
+type hashKind struct {
+	algo    string
+	enabled bool
+	newHash func() hash.Hash
+}
+
+// enabledHashKinds returns the hash algorithms config has turned on.
+func enabledHashKinds(config *Config) []hashKind {
+	return []hashKind{
+		{"md5", config.MD5, md5.New},
+		{"sha1", config.SHA1, sha1.New},
+		{"sha256", config.SHA256, sha256.New},
+		{"sha512", config.SHA512, sha512.New},
+	}
+}
+
+// computeEnabledSums hashes path with every algorithm config has enabled.
+func computeEnabledSums(config *Config, path string) (map[string]string, error) {
+	sums := make(map[string]string)
+	for _, kind := range enabledHashKinds(config) {
+		if !kind.enabled {
+			continue
+		}
+
+		sum, err := sumFile(kind.newHash(), path)
+		if err != nil {
+			return nil, err
+		}
+
+		sums[kind.algo] = sum
+	}
+	return sums, nil
+}
+
+// addArchiveSums hashes archiveFile with every hash algorithm enabled in
+// config and folds the results into manifest. Unlike the per-artifact
+// binary, archives don't get their own name.$algo.txt file, only an entry
+// in the combined manifest.
+func addArchiveSums(config *Config, manifest *SumManifest, archiveFile string) error {
+
+	sums, err := computeEnabledSums(config, archiveFile)
+	if err != nil {
+		return err
+	}
+
+	for algo, sum := range sums {
+		manifest.Add(algo, sum, filepath.Base(archiveFile))
+	}
+
+	return nil
+}
+
+// sumOrCached returns the sum for algo, reusing cachedSums when the artifact
+// was restored from the build cache and nothing since (compression, signing)
+// has changed its contents; otherwise it hashes path fresh.
+func sumOrCached(cacheHit, mutated bool, cachedSums map[string]string, algo string, newHash func() hash.Hash, path string) (string, error) {
+	if cacheHit && !mutated {
+		if sum, ok := cachedSums[algo]; ok {
+			return sum, nil
+		}
+	}
+	return sumFile(newHash(), path)
+}
+
+// Filenames returns the combined sums filenames written by Write, for
+// callers that need to sign them afterwards.
+func (m *SumManifest) Filenames(outDir string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.records))
+	for algo := range m.records {
+		names = append(names, filepath.Join(outDir, strings.ToUpper(algo)+"SUMS"))
+	}
+	sort.Strings(names)
+	return names
+}
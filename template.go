@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime/debug"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateContext is the data available to Go-template expansion of an
+// Artifact's Flags, eg. "-ldflags=-X main.version={{.Version}}".
+type TemplateContext struct {
+	Version     string
+	Commit      string
+	ShortCommit string
+	Branch      string
+	Date        string // commit date, RFC3339
+	BuildDate   string // time this build ran, RFC3339
+	Tag         string
+	Dirty       bool
+	OS          string
+	ARCH        string
+	Name        string
+}
+
+// buildTemplateContext resolves the VCS metadata for srcDir (shelling out to
+// git, or falling back to the embedded runtime/debug.BuildInfo VCS settings
+// when git isn't available) and combines it with artifact's own fields.
+func buildTemplateContext(ctx context.Context, srcDir string, artifact Artifact) (TemplateContext, error) {
+
+	tmplCtx := TemplateContext{
+		OS:        artifact.OS,
+		ARCH:      artifact.ARCH,
+		Name:      artifact.Name,
+		BuildDate: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	if commit, short, branch, tag, date, dirty, ok := gitMetadata(ctx, srcDir); ok {
+		tmplCtx.Commit = commit
+		tmplCtx.ShortCommit = short
+		tmplCtx.Branch = branch
+		tmplCtx.Tag = tag
+		tmplCtx.Date = date
+		tmplCtx.Dirty = dirty
+		tmplCtx.Version = tag
+		return tmplCtx, nil
+	}
+
+	if commit, date, dirty, ok := vcsBuildInfo(); ok {
+		tmplCtx.Commit = commit
+		tmplCtx.ShortCommit = commit
+		if len(tmplCtx.ShortCommit) > 12 {
+			tmplCtx.ShortCommit = tmplCtx.ShortCommit[:12]
+		}
+		tmplCtx.Date = date
+		tmplCtx.Dirty = dirty
+		return tmplCtx, nil
+	}
+
+	return tmplCtx, nil
+}
+
+// gitMetadata shells out to git in srcDir for commit, short commit, branch,
+// nearest tag, commit date and dirty status. ok is false when git isn't on
+// $PATH or srcDir isn't a git checkout.
+func gitMetadata(ctx context.Context, srcDir string) (commit, short, branch, tag, date string, dirty, ok bool) {
+
+	if _, err := exec.LookPath("git"); err != nil {
+		return "", "", "", "", "", false, false
+	}
+
+	run := func(args ...string) string {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = srcDir
+		out, err := cmd.Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	commit = run("rev-parse", "HEAD")
+	if commit == "" {
+		return "", "", "", "", "", false, false
+	}
+
+	short = run("rev-parse", "--short", "HEAD")
+	branch = run("rev-parse", "--abbrev-ref", "HEAD")
+	tag = run("describe", "--tags", "--abbrev=0")
+	date = run("log", "-1", "--format=%cI")
+	dirty = run("status", "--porcelain") != ""
+
+	return commit, short, branch, tag, date, dirty, true
+}
+
+// vcsBuildInfo falls back to the VCS settings Go embeds in the binary
+// (runtime/debug.BuildInfo) when git isn't available.
+func vcsBuildInfo() (commit, date string, dirty, ok bool) {
+	info, available := debug.ReadBuildInfo()
+	if !available {
+		return "", "", false, false
+	}
+
+	var revision string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.time":
+			date = setting.Value
+		case "vcs.modified":
+			dirty = setting.Value == "true"
+		}
+	}
+
+	if revision == "" {
+		return "", "", false, false
+	}
+
+	return revision, date, dirty, true
+}
+
+// resolveFlags expands each flag as a Go template against tmplCtx.
+//
+//	ex: flags, err := resolveFlags(artifact.Flags, tmplCtx)
+func resolveFlags(flags []string, tmplCtx TemplateContext) ([]string, error) {
+
+	resolved := make([]string, len(flags))
+
+	for i, flag := range flags {
+		tmpl, err := template.New("flag").Parse(flag)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing flag template %q: %w", flag, err)
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, tmplCtx); err != nil {
+			return nil, fmt.Errorf("error expanding flag template %q: %w", flag, err)
+		}
+
+		resolved[i] = buf.String()
+	}
+
+	return resolved, nil
+}
+
+// buildEnv combines config.Env and artifact.Env into cmd.Env-style
+// "KEY=VALUE" entries, with artifact.Env taking precedence on conflicts.
+func buildEnv(config *Config, artifact Artifact) []string {
+
+	env := make([]string, 0, len(config.Env)+len(artifact.Env))
+
+	for key, value := range config.Env {
+		env = append(env, key+"="+value)
+	}
+	for key, value := range artifact.Env {
+		env = append(env, key+"="+value)
+	}
+
+	return env
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+)
+
+// UPXConfig controls the optional post-build UPX compression pass.
+type UPXConfig struct {
+	Path  string   `json:"path,omitzero"`
+	Flags []string `json:"flags,omitzero"`
+
+	// Skip lists "GOOS/GOARCH" pairs that upx cannot pack, eg. "darwin/arm64".
+	Skip []string `json:"skip,omitzero"`
+}
+
+// defaultUPXFlags are used when Flags is empty.
+var defaultUPXFlags = []string{"--best", "--lzma"}
+
+// path returns the configured upx binary, defaulting to "upx" on $PATH.
+func (u *UPXConfig) path() string {
+	if u.Path != "" {
+		return u.Path
+	}
+	return "upx"
+}
+
+// flags returns the configured flags, falling back to defaultUPXFlags.
+func (u *UPXConfig) flags() []string {
+	if len(u.Flags) > 0 {
+		return u.Flags
+	}
+	return defaultUPXFlags
+}
+
+// skips reports whether GOOS/GOARCH is in the skiplist, eg. targets upx
+// can't pack such as darwin/arm64.
+func (u *UPXConfig) skips(goos, goarch string) bool {
+	pair := goos + "/" + goarch
+	for _, skip := range u.Skip {
+		if skip == pair {
+			return true
+		}
+	}
+	return false
+}
+
+// Compress runs upx against artifactFile in place, logging the size delta.
+//
+//	ex: err := config.UPX.Compress(ctx, logger, "build/example")
+func (u *UPXConfig) Compress(ctx context.Context, logger *slog.Logger, artifactFile string) error {
+
+	before, err := os.Stat(artifactFile)
+	if err != nil {
+		return fmt.Errorf("error statting artifact %s: %w", artifactFile, err)
+	}
+
+	args := append(append([]string{}, u.flags()...), artifactFile)
+	cmd := exec.CommandContext(ctx, u.path(), args...)
+
+	logger.Info("executing", "cmd", cmd.String())
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running upx on %s: %w", artifactFile, err)
+	}
+
+	after, err := os.Stat(artifactFile)
+	if err != nil {
+		return fmt.Errorf("error statting compressed artifact %s: %w", artifactFile, err)
+	}
+
+	logger.Info("compressed artifact", "before", before.Size(), "after", after.Size())
+
+	return nil
+}
+
+// anyCompressionRequested reports whether any artifact asks for upx
+// compression, so run() can fail fast if upx isn't installed.
+func anyCompressionRequested(config *Config) bool {
+	for _, artifact := range config.Artifacts {
+		if artifact.Compress {
+			return true
+		}
+	}
+	return false
+}